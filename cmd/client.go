@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 Sourcesense <eugenio.marzo@sourcesense.com>
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildRESTConfig resolves a Kubernetes client config using the standard
+// chain: --kubeconfig, then the KUBECONFIG environment variable, then
+// in-cluster ServiceAccount credentials, and finally the legacy
+// --token/--server-url flags for backwards compatibility with older
+// vmmig_bench deployments. The legacy path disables TLS verification, as
+// it did before, so it is only used when nothing else is available.
+func buildRESTConfig() (*rest.Config, error) {
+	if kubeconfigPath != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	}
+
+	if envPath := os.Getenv("KUBECONFIG"); envPath != "" {
+		return clientcmd.BuildConfigFromFlags("", envPath)
+	}
+
+	if cfg, err := rest.InClusterConfig(); err == nil {
+		return cfg, nil
+	}
+
+	if token != "" && serverURL != "" {
+		fmt.Println("Warning: no kubeconfig found, falling back to legacy --token/--server-url auth (TLS verification disabled)")
+		return &rest.Config{
+			Host:        serverURL,
+			BearerToken: token,
+			TLSClientConfig: rest.TLSClientConfig{
+				Insecure: true,
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unable to resolve a Kubernetes client config: set --kubeconfig, $KUBECONFIG, run in-cluster, or pass --token/--server-url")
+}
@@ -5,19 +5,27 @@ Copyright © 2025 Sourcesense <eugenio.marzo@sourcesense.com>
 package cmd
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rivo/tview"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // configCmd represents the config command
 var configCmd = &cobra.Command{
 	Use:   "config",
-	Short: "A Prometheus exporter designed to extract metrics for OpenShift Virtualization (KubeVirt)",
+	Short: "Interactively build a vmmig_bench configuration",
 	Long:  `...`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("config called")
 		startGUI()
 	},
 }
@@ -25,26 +33,207 @@ var configCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(configCmd)
 
-	// Here you will define your flags and configuration settings.
+	cobra.OnInitialize(loadPersistedConfig)
+}
+
+// configFilePath returns the path to the persisted vmmig_bench config,
+// honoring $XDG_CONFIG_HOME the same way os.UserConfigDir does.
+func configFilePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "vmmig_bench", "config.yaml"), nil
+}
+
+// loadPersistedConfig loads a previously saved config.yaml, if any, and
+// applies it to the start command's flag-backed variables, but only for
+// flags the user didn't pass explicitly on the command line - an explicit
+// --flag always wins over the persisted value. It is safe to call
+// unconditionally; a missing config file is not an error.
+func loadPersistedConfig() {
+	path, err := configFilePath()
+	if err != nil {
+		return
+	}
+
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		return
+	}
+
+	flags := startCmd.Flags()
+
+	if v := viper.GetString("server-url"); v != "" && !flags.Changed("server-url") {
+		serverURL = v
+	}
+	if v := viper.GetString("token"); v != "" && !flags.Changed("token") {
+		token = v
+	}
+	if v := viper.GetString("kubeconfig"); v != "" && !flags.Changed("kubeconfig") {
+		kubeconfigPath = v
+	}
+	if v := viper.GetString("namespaces"); v != "" && !flags.Changed("namespaces") {
+		namespaces = v
+	}
+	if v := viper.GetInt("scrape-interval"); v != 0 && !flags.Changed("scrape-interval") {
+		sleepSeconds = v
+	}
+	if v := viper.GetString("listen-address"); v != "" && !flags.Changed("listen-address") {
+		listenAddress = v
+	}
+}
+
+// savePersistedConfig writes the given values to config.yaml under
+// $XDG_CONFIG_HOME/vmmig_bench, creating the directory if needed.
+func savePersistedConfig(serverURLValue, tokenValue, kubeconfigValue, namespacesValue, listenAddressValue string, scrapeIntervalValue int) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	viper.Set("server-url", serverURLValue)
+	viper.Set("token", tokenValue)
+	viper.Set("kubeconfig", kubeconfigValue)
+	viper.Set("namespaces", namespacesValue)
+	viper.Set("scrape-interval", scrapeIntervalValue)
+	viper.Set("listen-address", listenAddressValue)
+
+	viper.SetConfigFile(path)
+	return viper.WriteConfigAs(path)
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// configCmd.PersistentFlags().String("foo", "", "A help for foo")
+// previewNamespace performs a single test GET against the KubeVirt
+// VirtualMachine list endpoint for one namespace, returning a short
+// status line for the live-preview panel.
+func previewNamespace(serverURLValue, tokenValue, namespace string) string {
+	if serverURLValue == "" || tokenValue == "" {
+		return fmt.Sprintf("%s: skipped (need server URL and token)", namespace)
+	}
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	url := fmt.Sprintf("%s/apis/kubevirt.io/v1/namespaces/%s/virtualmachines", serverURLValue, namespace)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Sprintf("%s: [red]error building request: %v[-]", namespace, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenValue)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("%s: [red]%v[-]", namespace, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s: [red]HTTP %d[-]", namespace, resp.StatusCode)
+	}
+
+	var vmList struct {
+		Items []struct{} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vmList); err != nil {
+		return fmt.Sprintf("%s: [red]could not parse response: %v[-]", namespace, err)
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// configCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	return fmt.Sprintf("%s: [green]ok[-], %d VM(s)", namespace, len(vmList.Items))
 }
 
+// startGUI builds and runs the interactive configurator: a form for the
+// exporter's connection settings, a live-preview panel that exercises
+// those settings against the cluster, and a Save action that persists
+// them to config.yaml.
 func startGUI() {
 	app := tview.NewApplication()
+	pages := tview.NewPages()
+
+	preview := tview.NewTextView().
+		SetDynamicColors(true).
+		SetChangedFunc(func() { app.Draw() })
+	preview.SetBorder(true).SetTitle("Live preview")
+	preview.SetText("Fill in the form and press \"Test connection\" to preview.")
+
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle("vmmig_bench configuration").SetTitleAlign(tview.AlignLeft)
+
+	form.AddInputField("Server URL", serverURL, 40, nil, nil)
+	form.AddPasswordField("Token", token, 40, '*', nil)
+	form.AddInputField("Kubeconfig path", kubeconfigPath, 40, nil, nil)
+	form.AddInputField("Namespaces (comma-separated)", namespaces, 40, nil, nil)
+	form.AddInputField("Scrape interval (seconds)", strconv.Itoa(sleepSeconds), 10, nil, nil)
+	form.AddInputField("Listen address", listenAddress, 40, nil, nil)
+
+	fieldValue := func(label string) string {
+		if item := form.GetFormItemByLabel(label); item != nil {
+			return item.(*tview.InputField).GetText()
+		}
+		return ""
+	}
+
+	form.AddButton("Test connection", func() {
+		serverURLValue := fieldValue("Server URL")
+		tokenValue := fieldValue("Token")
+		namespaceList := strings.Split(fieldValue("Namespaces (comma-separated)"), ",")
+
+		var lines []string
+		for _, namespace := range namespaceList {
+			namespace = strings.TrimSpace(namespace)
+			if namespace == "" {
+				continue
+			}
+			lines = append(lines, previewNamespace(serverURLValue, tokenValue, namespace))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "No namespaces to test.")
+		}
+		preview.SetText(strings.Join(lines, "\n"))
+	})
+
+	form.AddButton("Save", func() {
+		scrapeInterval, err := strconv.Atoi(fieldValue("Scrape interval (seconds)"))
+		if err != nil {
+			preview.SetText(fmt.Sprintf("[red]Invalid scrape interval: %v[-]", err))
+			return
+		}
+
+		err = savePersistedConfig(
+			fieldValue("Server URL"),
+			fieldValue("Token"),
+			fieldValue("Kubeconfig path"),
+			fieldValue("Namespaces (comma-separated)"),
+			fieldValue("Listen address"),
+			scrapeInterval,
+		)
+		if err != nil {
+			preview.SetText(fmt.Sprintf("[red]Failed to save config: %v[-]", err))
+			return
+		}
+
+		path, _ := configFilePath()
+		preview.SetText(fmt.Sprintf("[green]Saved config to %s[-]", path))
+	})
+
+	form.AddButton("Quit", func() {
+		app.Stop()
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 2, true).
+		AddItem(preview, 0, 1, false)
 
-	textView := tview.NewTextView().
-		SetText("Hello, world!").
-		SetTextAlign(tview.AlignCenter).
-		SetDynamicColors(true)
+	pages.AddPage("main", layout, true, true)
 
-	if err := app.SetRoot(textView, true).Run(); err != nil {
+	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
 		panic(err)
 	}
 }
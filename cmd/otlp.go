@@ -0,0 +1,334 @@
+/*
+Copyright © 2025 Sourcesense <eugenio.marzo@sourcesense.com>
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+var (
+	otlpEndpoint string
+	otlpHeaders  string
+	otlpProtocol string
+)
+
+func init() {
+	startCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP endpoint to push metrics to, e.g. otel-collector:4317 (OTLP push disabled when empty)")
+	startCmd.Flags().StringVar(&otlpHeaders, "otlp-headers", "", "Comma-separated key=value headers sent with every OTLP export")
+	startCmd.Flags().StringVar(&otlpProtocol, "otlp-protocol", "grpc", "OTLP wire protocol to use: grpc or http")
+}
+
+// startOTLPPusher periodically gathers registry and pushes it to
+// otlpEndpoint as OTLP metrics, on the same cadence as the informer
+// resync period. It runs until stopCh is closed and is a no-op when
+// otlpEndpoint is unset, so OTLP push is strictly additive to the
+// existing /metrics pull endpoint.
+func startOTLPPusher(registry *prometheus.Registry, stopCh <-chan struct{}) {
+	if otlpEndpoint == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exporter, err := newOTLPExporter(ctx)
+	if err != nil {
+		fmt.Printf("Error creating OTLP exporter: %v\n", err)
+		return
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("vmmig_bench")),
+	)
+	if err != nil {
+		fmt.Printf("Error building OTLP resource: %v\n", err)
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(resyncPeriod())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := exporter.Shutdown(shutdownCtx); err != nil {
+					fmt.Printf("Error shutting down OTLP exporter: %v\n", err)
+				}
+				shutdownCancel()
+				return
+			case <-ticker.C:
+				pushOnce(exporter, registry, res)
+			}
+		}
+	}()
+}
+
+func pushOnce(exporter sdkmetric.Exporter, registry *prometheus.Registry, res *resource.Resource) {
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Printf("Error gathering metrics for OTLP push: %v\n", err)
+		return
+	}
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: res,
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope:   instrumentation.Scope{Name: "vmmig_bench"},
+				Metrics: convertMetricFamilies(families),
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := exporter.Export(ctx, rm); err != nil {
+		fmt.Printf("Error pushing OTLP metrics: %v\n", err)
+	}
+}
+
+// newOTLPExporter builds a push exporter for otlpProtocol, attaching
+// otlpHeaders to every export.
+func newOTLPExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	headers := parseOTLPHeaders(otlpHeaders)
+
+	switch otlpProtocol {
+	case "grpc":
+		return otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpoint(otlpEndpoint),
+			otlpmetricgrpc.WithHeaders(headers),
+			otlpmetricgrpc.WithInsecure(),
+		)
+	case "http":
+		return otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpoint(otlpEndpoint),
+			otlpmetrichttp.WithHeaders(headers),
+		)
+	default:
+		return nil, fmt.Errorf("unsupported --otlp-protocol %q: must be \"grpc\" or \"http\"", otlpProtocol)
+	}
+}
+
+func parseOTLPHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	if raw == "" {
+		return headers
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// convertMetricFamilies translates gathered Prometheus MetricFamily
+// values into their OTLP equivalents: gauge -> Gauge, counter -> a
+// monotonic cumulative Sum, and histogram -> Histogram, or
+// ExponentialHistogram when the family carries native (sparse) histogram
+// buckets.
+func convertMetricFamilies(families []*dto.MetricFamily) []metricdata.Metrics {
+	now := time.Now()
+
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, family := range families {
+		switch family.GetType() {
+		case dto.MetricType_GAUGE:
+			metrics = append(metrics, metricdata.Metrics{
+				Name:        family.GetName(),
+				Description: family.GetHelp(),
+				Data:        convertGauge(family, now),
+			})
+		case dto.MetricType_COUNTER:
+			metrics = append(metrics, metricdata.Metrics{
+				Name:        family.GetName(),
+				Description: family.GetHelp(),
+				Data:        convertCounter(family, now),
+			})
+		case dto.MetricType_HISTOGRAM:
+			metrics = append(metrics, metricdata.Metrics{
+				Name:        family.GetName(),
+				Description: family.GetHelp(),
+				Data:        convertHistogram(family, now),
+			})
+		default:
+			fmt.Printf("Skipping OTLP push for metric family %q: unsupported type %s\n", family.GetName(), family.GetType())
+		}
+	}
+	return metrics
+}
+
+func convertGauge(family *dto.MetricFamily, now time.Time) metricdata.Gauge[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(family.Metric))
+	for _, m := range family.Metric {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: labelsToAttributeSet(m.GetLabel()),
+			Time:       now,
+			Value:      m.GetGauge().GetValue(),
+		})
+	}
+	return metricdata.Gauge[float64]{DataPoints: points}
+}
+
+func convertCounter(family *dto.MetricFamily, now time.Time) metricdata.Sum[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(family.Metric))
+	for _, m := range family.Metric {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: labelsToAttributeSet(m.GetLabel()),
+			Time:       now,
+			Value:      m.GetCounter().GetValue(),
+		})
+	}
+	return metricdata.Sum[float64]{
+		DataPoints:  points,
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+	}
+}
+
+func convertHistogram(family *dto.MetricFamily, now time.Time) metricdata.Aggregation {
+	if isNativeHistogram(family) {
+		return convertExponentialHistogram(family, now)
+	}
+
+	points := make([]metricdata.HistogramDataPoint[float64], 0, len(family.Metric))
+	for _, m := range family.Metric {
+		h := m.GetHistogram()
+
+		bounds := make([]float64, 0, len(h.GetBucket()))
+		counts := make([]uint64, 0, len(h.GetBucket())+1)
+		var lastCumulative uint64
+		for _, bucket := range h.GetBucket() {
+			bounds = append(bounds, bucket.GetUpperBound())
+			cumulative := bucket.GetCumulativeCount()
+			counts = append(counts, cumulative-lastCumulative)
+			lastCumulative = cumulative
+		}
+		// OTLP BucketCounts is per-bucket (not cumulative) and carries one
+		// more entry than Bounds: the (lastBound, +Inf) overflow bucket,
+		// which Prometheus's dto.Histogram.Bucket list omits since its
+		// count is implied by SampleCount.
+		counts = append(counts, h.GetSampleCount()-lastCumulative)
+
+		points = append(points, metricdata.HistogramDataPoint[float64]{
+			Attributes:   labelsToAttributeSet(m.GetLabel()),
+			Time:         now,
+			Count:        h.GetSampleCount(),
+			Sum:          h.GetSampleSum(),
+			Bounds:       bounds,
+			BucketCounts: counts,
+		})
+	}
+
+	return metricdata.Histogram[float64]{
+		DataPoints:  points,
+		Temporality: metricdata.CumulativeTemporality,
+	}
+}
+
+// isNativeHistogram reports whether family carries sparse/exponential
+// histogram data, i.e. any sample has a non-empty positive or negative
+// bucket span (set when NativeHistogramBucketFactor is configured on the
+// collector).
+func isNativeHistogram(family *dto.MetricFamily) bool {
+	for _, m := range family.Metric {
+		h := m.GetHistogram()
+		if len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func convertExponentialHistogram(family *dto.MetricFamily, now time.Time) metricdata.ExponentialHistogram[float64] {
+	points := make([]metricdata.ExponentialHistogramDataPoint[float64], 0, len(family.Metric))
+	for _, m := range family.Metric {
+		h := m.GetHistogram()
+
+		points = append(points, metricdata.ExponentialHistogramDataPoint[float64]{
+			Attributes:     labelsToAttributeSet(m.GetLabel()),
+			Time:           now,
+			Count:          h.GetSampleCount(),
+			Sum:            h.GetSampleSum(),
+			Scale:          h.GetSchema(),
+			ZeroCount:      h.GetZeroCount(),
+			PositiveBucket: denseBucketFromSpans(h.GetPositiveSpan(), h.GetPositiveDelta()),
+			NegativeBucket: denseBucketFromSpans(h.GetNegativeSpan(), h.GetNegativeDelta()),
+		})
+	}
+
+	return metricdata.ExponentialHistogram[float64]{
+		DataPoints:  points,
+		Temporality: metricdata.CumulativeTemporality,
+	}
+}
+
+// denseBucketFromSpans converts Prometheus's sparse native-histogram
+// encoding - one BucketSpan per run of consecutive populated buckets,
+// with gaps implied by each span's Offset, and delta-encoded counts
+// within a span - into OTLP's single contiguous Offset+Counts bucket,
+// zero-filling the gaps between spans.
+//
+// It also shifts the bucket index by one to reconcile the two formats'
+// differing bucket-boundary convention: Prometheus bucket index i is
+// upper-inclusive, covering (base^(i-1), base^i], while OTLP bucket
+// index i covers (base^i, base^(i+1)] - i.e. Prometheus index i is
+// OTLP index i-1.
+func denseBucketFromSpans(spans []*dto.BucketSpan, deltas []int64) metricdata.ExponentialBucket {
+	if len(spans) == 0 {
+		return metricdata.ExponentialBucket{}
+	}
+
+	counts := make([]uint64, 0, len(deltas))
+	var running int64
+	deltaIdx := 0
+
+	for i, span := range spans {
+		if i > 0 {
+			for gap := int32(0); gap < span.GetOffset(); gap++ {
+				counts = append(counts, 0)
+			}
+		}
+
+		for j := uint32(0); j < span.GetLength(); j++ {
+			running += deltas[deltaIdx]
+			deltaIdx++
+			counts = append(counts, uint64(running))
+		}
+	}
+
+	return metricdata.ExponentialBucket{
+		Offset: spans[0].GetOffset() - 1,
+		Counts: counts,
+	}
+}
+
+func labelsToAttributeSet(labels []*dto.LabelPair) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2025 Sourcesense <eugenio.marzo@sourcesense.com>
+*/
+
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	apiRequestsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vmmig_bench_api_requests_total",
+		Help: "Total number of Kubernetes API requests made by the exporter, per endpoint and HTTP status code",
+	}, []string{"endpoint", "code"})
+
+	apiRequestDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vmmig_bench_api_request_duration_seconds",
+		Help:    "Duration of Kubernetes API requests made by the exporter, per endpoint",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	scrapeErrorsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vmmig_bench_scrape_errors_total",
+		Help: "Total number of errors encountered while collecting metrics, per namespace and error kind",
+	}, []string{"namespace", "kind"})
+
+	lastSuccessfulScrapeMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vmmig_bench_last_successful_scrape_timestamp_seconds",
+		Help: "Unix timestamp of the last successful metrics update, per namespace",
+	}, []string{"namespace"})
+)
+
+func init() {
+	prometheus.MustRegister(apiRequestsMetric)
+	prometheus.MustRegister(apiRequestDurationMetric)
+	prometheus.MustRegister(scrapeErrorsMetric)
+	prometheus.MustRegister(lastSuccessfulScrapeMetric)
+}
+
+// instrumentRESTConfig wraps restConfig's HTTP transport so every request
+// the resulting client makes (informer list/watch calls included) is
+// recorded in apiRequestsMetric and apiRequestDurationMetric.
+func instrumentRESTConfig(restConfig *rest.Config) {
+	restConfig.WrapTransport = func(next http.RoundTripper) http.RoundTripper {
+		return &instrumentingRoundTripper{next: next}
+	}
+}
+
+type instrumentingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt *instrumentingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Path
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	apiRequestDurationMetric.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequestsMetric.WithLabelValues(endpoint, code).Inc()
+
+	return resp, err
+}
+
+func recordScrapeError(namespace, kind string) {
+	scrapeErrorsMetric.WithLabelValues(namespace, kind).Inc()
+}
+
+func recordSuccessfulScrape(namespace string) {
+	lastSuccessfulScrapeMetric.WithLabelValues(namespace).Set(float64(time.Now().Unix()))
+}
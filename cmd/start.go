@@ -5,26 +5,32 @@ Copyright © 2025 Sourcesense <eugenio.marzo@sourcesense.com>
 package cmd
 
 import (
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
 )
 
 var (
-	token        string
-	serverURL    string
-	namespaces   string
-	sleepSeconds int
+	token          string
+	serverURL      string
+	kubeconfigPath string
+	namespaces     string
+	sleepSeconds   int
+	listenAddress  string
 
 	// Prometheus metrics
 	vmCountMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -42,19 +48,89 @@ var (
 		Help: "Total number of failed migrations per namespace",
 	}, []string{"namespace"})
 
-	migrationTimeMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "virtual_machine_migration_time_seconds",
-		Help: "Time taken for virtual machine migrations in the namespace",
-	}, []string{"namespace", "vm_name"})
+	migrationDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "virtual_machine_migration_duration_seconds",
+		Help:    "Duration of virtual machine migrations in the namespace, observed once per completed migration",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+		// Also emit native (sparse) histogram data so scrapers that
+		// negotiate the native-histogram protobuf format can run
+		// histogram_quantile over long time ranges without being
+		// bound by the fixed buckets above.
+		NativeHistogramBucketFactor:    1.1,
+		NativeHistogramMaxBucketNumber: 100,
+	}, []string{"namespace"})
+
+	migrationPhaseDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "virtual_machine_migration_phase_duration_seconds",
+		Help:    "Duration of individual virtual machine migration pipeline phases, e.g. DiskTransfer, Conversion, VirtualMachineCreation, PostHook",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"namespace", "phase"})
+
+	migrationPhaseTransitionsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "virtual_machine_migration_phase_transitions_total",
+		Help: "Total number of virtual machine migration pipeline phase entries observed, per namespace, phase and result",
+	}, []string{"namespace", "phase", "result"})
+)
+
+// observedMigrations dedupes (migration UID, VM name) pairs so a Forklift
+// Migration object re-observed across informer resyncs doesn't cause the
+// same completed migration to be counted twice in migrationDurationMetric.
+var (
+	observedMigrations   = make(map[string]struct{})
+	observedMigrationsMu sync.Mutex
+)
+
+// observedPhases dedupes (migration UID, VM name, pipeline stage name,
+// result) quadruples so migrationPhaseTransitionsMetric counts each stage
+// result exactly once instead of once per informer resync, while still
+// counting a stage again if it later transitions to a different result
+// (e.g. Running -> Failed).
+var (
+	observedPhases   = make(map[string]struct{})
+	observedPhasesMu sync.Mutex
+)
+
+// observedPhaseDurations dedupes (migration UID, VM name, pipeline stage
+// name) triples, independently of observedPhases, so
+// migrationPhaseDurationMetric keeps observing each stage's duration
+// exactly once regardless of how many distinct results it was seen with.
+var (
+	observedPhaseDurations   = make(map[string]struct{})
+	observedPhaseDurationsMu sync.Mutex
+)
+
+// GroupVersionResources for the CRDs this exporter watches.
+var (
+	virtualMachineGVR = schema.GroupVersionResource{
+		Group:    "kubevirt.io",
+		Version:  "v1",
+		Resource: "virtualmachines",
+	}
+
+	forkliftMigrationGVR = schema.GroupVersionResource{
+		Group:    "forklift.konveyor.io",
+		Version:  "v1beta1",
+		Resource: "migrations",
+	}
+)
+
+// vmStatusTracker remembers the last observed status per namespace/VM so
+// stale series can be removed from vmStatusMetric when a VM's status
+// changes, instead of leaving the old (namespace, vm_name, status) label
+// set behind forever.
+var (
+	vmStatusTracker   = make(map[string]map[string]string)
+	vmStatusTrackerMu sync.Mutex
 )
 
 func init() {
-	sleepSeconds = 15
 	// Register Prometheus metrics
 	prometheus.MustRegister(vmCountMetric)
 	prometheus.MustRegister(vmStatusMetric)
 	prometheus.MustRegister(failedMigrationsMetric)
-	prometheus.MustRegister(migrationTimeMetric)
+	prometheus.MustRegister(migrationDurationMetric)
+	prometheus.MustRegister(migrationPhaseDurationMetric)
+	prometheus.MustRegister(migrationPhaseTransitionsMetric)
 }
 
 // startCmd represents the start command
@@ -63,8 +139,8 @@ var startCmd = &cobra.Command{
 	Short: "A Prometheus exporter designed to extract metrics for OpenShift Virtualization (KubeVirt)",
 	Long:  `...`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if token == "" || serverURL == "" || namespaces == "" {
-			fmt.Println("Error: --token, --server-url, and --namespaces are required parameters")
+		if namespaces == "" {
+			fmt.Println("Error: --namespaces is a required parameter")
 			cmd.Usage()
 			os.Exit(1)
 		}
@@ -75,9 +151,22 @@ var startCmd = &cobra.Command{
 		fmt.Println("          vmmig_bench Exporter          ")
 		fmt.Println("          Powered by DevOpsTribe.it     ")
 		fmt.Println("========================================")
-		fmt.Printf("start called with --token=*** --server-url=%s --namespaces=%v\n", serverURL, namespaceList)
+		fmt.Printf("start called with --namespaces=%v\n", namespaceList)
 		fmt.Println("Starting Prometheus exporter...")
 
+		restConfig, err := buildRESTConfig()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		instrumentRESTConfig(restConfig)
+
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			fmt.Printf("Error building Kubernetes dynamic client: %v\n", err)
+			os.Exit(1)
+		}
+
 		// Prometheus exporter initialization
 		fmt.Println("Initializing Prometheus exporter...")
 		registry := prometheus.NewRegistry()
@@ -100,11 +189,11 @@ var startCmd = &cobra.Command{
 			}
 		}
 
-		if err := registry.Register(migrationTimeMetric); err != nil {
+		if err := registry.Register(migrationDurationMetric); err != nil {
 			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-				migrationTimeMetric = are.ExistingCollector.(*prometheus.GaugeVec)
+				migrationDurationMetric = are.ExistingCollector.(*prometheus.HistogramVec)
 			} else {
-				fmt.Printf("Error registering migrationTimeMetric: %v\n", err)
+				fmt.Printf("Error registering migrationDurationMetric: %v\n", err)
 				os.Exit(1)
 			}
 		}
@@ -118,25 +207,48 @@ var startCmd = &cobra.Command{
 			}
 		}
 
-		// Start a background thread to update the VM count for each namespace
-		go func() {
-			for {
-				for _, namespace := range namespaceList {
-					exportVirtualMachineCount(serverURL, token, namespace)
-					exportVirtualMachineNamesAndStatuses(serverURL, token, namespace)
-				}
-				exportVirtualMachineMigrationTime(serverURL, token)
+		if err := registry.Register(migrationPhaseDurationMetric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				migrationPhaseDurationMetric = are.ExistingCollector.(*prometheus.HistogramVec)
+			} else {
+				fmt.Printf("Error registering migrationPhaseDurationMetric: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
-				time.Sleep(time.Duration(sleepSeconds) * time.Second) // Update every sleepSeconds
+		if err := registry.Register(migrationPhaseTransitionsMetric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				migrationPhaseTransitionsMetric = are.ExistingCollector.(*prometheus.CounterVec)
+			} else {
+				fmt.Printf("Error registering migrationPhaseTransitionsMetric: %v\n", err)
+				os.Exit(1)
 			}
-		}()
+		}
+
+		registry.MustRegister(apiRequestsMetric)
+		registry.MustRegister(apiRequestDurationMetric)
+		registry.MustRegister(scrapeErrorsMetric)
+		registry.MustRegister(lastSuccessfulScrapeMetric)
+		registry.MustRegister(collectors.NewGoCollector())
+		registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+		stopCh := make(chan struct{})
+		defer close(stopCh)
 
-		http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		for _, namespace := range namespaceList {
+			startVirtualMachineInformer(dynamicClient, namespace, stopCh)
+		}
+		startForkliftMigrationInformer(dynamicClient, stopCh)
+		startOTLPPusher(registry, stopCh)
+
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(
+			registry, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		))
 		fmt.Println("Prometheus exporter initialized successfully.")
 
 		// Start Prometheus exporter
-		fmt.Println("Starting Prometheus exporter on :8080")
-		if err := http.ListenAndServe(":8080", nil); err != nil {
+		fmt.Printf("Starting Prometheus exporter on %s\n", listenAddress)
+		if err := http.ListenAndServe(listenAddress, nil); err != nil {
 			fmt.Printf("Error starting Prometheus exporter: %v\n", err)
 			os.Exit(1)
 		}
@@ -146,198 +258,273 @@ var startCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(startCmd)
 
-	startCmd.Flags().StringVar(&token, "token", "", "Authentication token (required)")
-	startCmd.Flags().StringVar(&serverURL, "server-url", "", "Server URL (required)")
+	startCmd.Flags().StringVar(&token, "token", "", "Authentication token, used only when --kubeconfig/$KUBECONFIG/in-cluster config are unavailable")
+	startCmd.Flags().StringVar(&serverURL, "server-url", "", "Server URL, used only when --kubeconfig/$KUBECONFIG/in-cluster config are unavailable")
+	startCmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to a kubeconfig file (defaults to $KUBECONFIG, then in-cluster config)")
 	startCmd.Flags().StringVar(&namespaces, "namespaces", "", "Comma-separated list of namespaces (required)")
+	startCmd.Flags().IntVar(&sleepSeconds, "scrape-interval", 15, "Informer resync interval, in seconds")
+	startCmd.Flags().StringVar(&listenAddress, "listen-address", ":8080", "Address the /metrics endpoint listens on")
 }
 
-func exportVirtualMachineMigrationTime(serverURL, token string) (bool, error) {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// resyncPeriod returns the configured scrape interval as the period the
+// informer factories use to periodically re-list and re-deliver events for
+// objects already in their store, on top of the real-time watch events
+// they deliver as changes happen.
+func resyncPeriod() time.Duration {
+	return time.Duration(sleepSeconds) * time.Second
+}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/apis/forklift.konveyor.io/v1beta1/migrations", serverURL), nil)
+// startVirtualMachineInformer watches KubeVirt VirtualMachine objects in
+// namespace and keeps vmCountMetric/vmStatusMetric up to date as events
+// arrive, instead of polling on a fixed interval.
+func startVirtualMachineInformer(client dynamic.Interface, namespace string, stopCh <-chan struct{}) {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod(), namespace, nil)
+	informer := factory.ForResource(virtualMachineGVR).Informer()
+
+	onChange := func(interface{}) {
+		updateVirtualMachineMetrics(namespace, informer)
+	}
 
-	fmt.Printf("Request URL: %s\n", req.URL.String())
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(oldObj, newObj interface{}) { onChange(newObj) },
+		DeleteFunc: onChange,
+	})
 
-	if err != nil {
-		fmt.Printf("Failed to create request for migrations endpoint: %v\n", err)
-		return false, err
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		fmt.Printf("Error: timed out waiting for VirtualMachine informer cache to sync in namespace %s\n", namespace)
+		recordScrapeError(namespace, "sync_timeout")
 	}
+}
 
-	// Create a custom HTTP client that ignores TLS verification
-	client := &http.Client{}
+func updateVirtualMachineMetrics(namespace string, informer cache.SharedIndexInformer) {
+	objs := informer.GetStore().List()
+	vmCountMetric.WithLabelValues(namespace).Set(float64(len(objs)))
 
-	req.Header.Set("Authorization", "Bearer "+token)
+	current := make(map[string]string, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-	fmt.Printf("Response status code when calling API for migrations: %d\n", resp.StatusCode)
+		name := u.GetName()
+		status, _, _ := unstructured.NestedString(u.Object, "status", "printableStatus")
+		current[name] = status
 
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		// Set to 1 to indicate the VM exists with the given status
+		vmStatusMetric.WithLabelValues(namespace, name, status).Set(1)
 	}
 
-	// Parse the response to extract migration times
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
+	vmStatusTrackerMu.Lock()
+	for name, staleStatus := range vmStatusTracker[namespace] {
+		if current[name] != staleStatus {
+			vmStatusMetric.DeleteLabelValues(namespace, name, staleStatus)
+		}
 	}
+	vmStatusTracker[namespace] = current
+	vmStatusTrackerMu.Unlock()
 
-	var migrations struct {
-		Items []struct {
-			Status struct {
-				Namespace string `json:"namespace"`
-				Vms       []struct {
-					Name      string `json:"name"`
-					Started   string `json:"started"`
-					Completed string `json:"completed"`
-				} `json:"vms"`
-			} `json:"status"`
-		} `json:"items"`
-	}
+	recordSuccessfulScrape(namespace)
+}
 
-	if err := json.Unmarshal(body, &migrations); err != nil {
-		return false, err
+// startForkliftMigrationInformer watches Forklift Migration objects
+// cluster-wide and records per-VM migration durations as their
+// started/completed timestamps are observed.
+func startForkliftMigrationInformer(client dynamic.Interface, stopCh <-chan struct{}) {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, resyncPeriod())
+	informer := factory.ForResource(forkliftMigrationGVR).Informer()
+
+	onChange := func(obj interface{}) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		recordMigrationTimes(u)
 	}
 
-	for _, migration := range migrations.Items {
-		for _, vm := range migration.Status.Vms {
-			started, err := time.Parse(time.RFC3339, vm.Started)
-			if err != nil {
-				fmt.Printf("Error parsing start time for VM %s: %v\n", vm.Name, err)
-				continue
+	onDelete := func(obj interface{}) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+			if !ok {
+				return
 			}
-			fmt.Printf("VM %s started at: %s\n", vm.Name, started)
-			completed, err := time.Parse(time.RFC3339, vm.Completed)
-			if err != nil {
-				fmt.Printf("Error parsing completion time for VM %s: %v\n", vm.Name, err)
-				continue
+			u, ok = tombstone.Obj.(*unstructured.Unstructured)
+			if !ok {
+				return
 			}
-			fmt.Printf("VM %s completed at: %s\n", vm.Name, completed)
-
-			duration := completed.Sub(started).Seconds()
-			// if duration > 60 {
-			// 	duration = duration / 60
-			// 	fmt.Printf("VM %s migration duration: %f minutes\n", vm.Name, duration)
-			// 	migrationTimeMetric.WithLabelValues(migration.Status.Namespace, vm.Name).Set(duration)
-			// } else {
-			// 	migrationTimeMetric.WithLabelValues(migration.Status.Namespace).Set(duration)
-			// }
-
-			fmt.Printf("VM %s migration duration: %f seconds\n", vm.Name, duration)
-			migrationTimeMetric.WithLabelValues(migration.Status.Namespace, vm.Name).Set(duration)
-
 		}
+		forgetMigration(string(u.GetUID()))
 	}
 
-	return true, nil
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(oldObj, newObj interface{}) { onChange(newObj) },
+		DeleteFunc: onDelete,
+	})
 
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		fmt.Println("Error: timed out waiting for Migration informer cache to sync")
+		recordScrapeError("", "sync_timeout")
+	}
 }
 
-func exportVirtualMachineNamesAndStatuses(serverURL, token, namespace string) (map[string]string, error) {
-	fmt.Printf("Fetching virtual machine names and statuses for namespace %s...\n", namespace)
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// recordMigrationTimes parses status.vms[].started/completed off a
+// Forklift Migration object and observes migrationDurationMetric once per
+// (migration UID, VM name) pair, so repeated informer resyncs of the same
+// completed migration don't double-count.
+func recordMigrationTimes(migration *unstructured.Unstructured) {
+	namespace, _, _ := unstructured.NestedString(migration.Object, "status", "namespace")
+	migrationUID := string(migration.GetUID())
+
+	vms, _, _ := unstructured.NestedSlice(migration.Object, "status", "vms")
+	for _, raw := range vms {
+		vm, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/apis/kubevirt.io/v1/namespaces/%s/virtualmachines", serverURL, namespace), nil)
-	fmt.Printf("Request URL: %s\n", req.URL.String())
-	if err != nil {
-		return nil, err
-	}
+		name, _ := vm["name"].(string)
 
-	// Create a custom HTTP client that ignores TLS verification
-	client := &http.Client{}
+		pipeline, _ := vm["pipeline"].([]interface{})
+		recordPipelinePhases(namespace, migrationUID, name, pipeline)
 
-	req.Header.Set("Authorization", "Bearer "+token)
+		startedStr, _ := vm["started"].(string)
+		completedStr, _ := vm["completed"].(string)
+		if startedStr == "" || completedStr == "" {
+			continue
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		started, err := time.Parse(time.RFC3339, startedStr)
+		if err != nil {
+			fmt.Printf("Error parsing start time for VM %s: %v\n", name, err)
+			recordScrapeError(namespace, "parse_error")
+			continue
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+		completed, err := time.Parse(time.RFC3339, completedStr)
+		if err != nil {
+			fmt.Printf("Error parsing completion time for VM %s: %v\n", name, err)
+			recordScrapeError(namespace, "parse_error")
+			continue
+		}
 
-	// Parse the response to extract VM names and statuses
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+		dedupKey := migrationUID + "/" + name
+		observedMigrationsMu.Lock()
+		_, alreadyObserved := observedMigrations[dedupKey]
+		observedMigrations[dedupKey] = struct{}{}
+		observedMigrationsMu.Unlock()
+		if alreadyObserved {
+			continue
+		}
 
-	var vmList struct {
-		Items []struct {
-			Metadata struct {
-				Name string `json:"name"`
-			} `json:"metadata"`
-			Status struct {
-				PrintableStatus string `json:"printableStatus"`
-			} `json:"status"`
-		} `json:"items"`
+		duration := completed.Sub(started).Seconds()
+		fmt.Printf("VM %s migration duration: %f seconds\n", name, duration)
+		migrationDurationMetric.WithLabelValues(namespace).Observe(duration)
+		recordSuccessfulScrape(namespace)
 	}
+}
 
-	if err := json.Unmarshal(body, &vmList); err != nil {
-		return nil, err
+// forgetMigration prunes every dedup-map entry keyed under migrationUID,
+// called when the Forklift informer observes the Migration object's
+// deletion so a long-running exporter doesn't accumulate one entry per
+// (migration, VM) pair for the rest of the process lifetime.
+func forgetMigration(migrationUID string) {
+	prefix := migrationUID + "/"
+
+	observedMigrationsMu.Lock()
+	for key := range observedMigrations {
+		if strings.HasPrefix(key, prefix) {
+			delete(observedMigrations, key)
+		}
 	}
+	observedMigrationsMu.Unlock()
 
-	vmNamesAndStatuses := make(map[string]string)
-	for _, vm := range vmList.Items {
-		vmNamesAndStatuses[vm.Metadata.Name] = vm.Status.PrintableStatus
-
-		// Expose VM status as a Prometheus metric
-		vmStatusMetric.WithLabelValues(namespace, vm.Metadata.Name, vm.Status.PrintableStatus).Set(1) // Set to 1 to indicate the VM exists with the given status
+	observedPhasesMu.Lock()
+	for key := range observedPhases {
+		if strings.HasPrefix(key, prefix) {
+			delete(observedPhases, key)
+		}
 	}
+	observedPhasesMu.Unlock()
 
-	return vmNamesAndStatuses, nil
+	observedPhaseDurationsMu.Lock()
+	for key := range observedPhaseDurations {
+		if strings.HasPrefix(key, prefix) {
+			delete(observedPhaseDurations, key)
+		}
+	}
+	observedPhaseDurationsMu.Unlock()
 }
 
-// getVirtualMachineCount fetches the number of virtual machines from OpenShift Virtualization
-func exportVirtualMachineCount(serverURL, token, namespace string) (int, error) {
-	// Simulate API call to OpenShift Virtualization
-	fmt.Printf("Fetching virtual machine count for namespace %s...\n", namespace)
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// recordPipelinePhases parses status.vms[].pipeline[] off a Forklift
+// Migration object, counting each (stage, result) pair (e.g. DiskTransfer
+// Running, DiskTransfer Succeeded, Conversion Failed) in
+// migrationPhaseTransitionsMetric so failure counts per phase are
+// queryable, and, once a stage has both a started and completed
+// timestamp, observing its duration in migrationPhaseDurationMetric. A
+// transition is only counted once per (migration UID, VM name, stage
+// name, result) quadruple, and a duration is only observed once per
+// (migration UID, VM name, stage name) triple - both for the same reason
+// recordMigrationTimes dedupes whole-migration durations.
+func recordPipelinePhases(namespace, migrationUID, vmName string, pipeline []interface{}) {
+	for _, raw := range pipeline {
+		stage, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/apis/kubevirt.io/v1/namespaces/%s/virtualmachines", serverURL, namespace), nil)
-	fmt.Printf("Request URL: %s\n", req.URL.String())
-	if err != nil {
-		return 0, err
-	}
+		stageName, _ := stage["name"].(string)
+		if stageName == "" {
+			continue
+		}
 
-	// Create a custom HTTP client that ignores TLS verification
-	client := &http.Client{}
+		result, _ := stage["phase"].(string)
+		if result == "" {
+			result = "Unknown"
+		}
 
-	req.Header.Set("Authorization", "Bearer "+token)
+		transitionKey := migrationUID + "/" + vmName + "/" + stageName + "/" + result
+		observedPhasesMu.Lock()
+		_, alreadyObserved := observedPhases[transitionKey]
+		observedPhases[transitionKey] = struct{}{}
+		observedPhasesMu.Unlock()
+		if !alreadyObserved {
+			migrationPhaseTransitionsMetric.WithLabelValues(namespace, stageName, result).Inc()
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+		startedStr, _ := stage["started"].(string)
+		completedStr, _ := stage["completed"].(string)
+		if startedStr == "" || completedStr == "" {
+			continue
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+		durationKey := migrationUID + "/" + vmName + "/" + stageName
+		observedPhaseDurationsMu.Lock()
+		_, durationObserved := observedPhaseDurations[durationKey]
+		observedPhaseDurations[durationKey] = struct{}{}
+		observedPhaseDurationsMu.Unlock()
+		if durationObserved {
+			continue
+		}
 
-	// Parse the response to count the virtual machines
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
-	}
+		started, err := time.Parse(time.RFC3339, startedStr)
+		if err != nil {
+			fmt.Printf("Error parsing start time for phase %s of VM %s: %v\n", stageName, vmName, err)
+			recordScrapeError(namespace, "parse_error")
+			continue
+		}
 
-	var vmList struct {
-		Items []struct{} `json:"items"`
-	}
+		completed, err := time.Parse(time.RFC3339, completedStr)
+		if err != nil {
+			fmt.Printf("Error parsing completion time for phase %s of VM %s: %v\n", stageName, vmName, err)
+			recordScrapeError(namespace, "parse_error")
+			continue
+		}
 
-	if err := json.Unmarshal(body, &vmList); err != nil {
-		return 0, err
+		migrationPhaseDurationMetric.WithLabelValues(namespace, stageName).Observe(completed.Sub(started).Seconds())
 	}
-
-	// Return the count of virtual machines
-	count := len(vmList.Items)
-
-	vmCountMetric.WithLabelValues(namespace).Set(float64(count))
-
-	return count, nil
 }